@@ -0,0 +1,84 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package credentialprovider
+
+import (
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the root of the credential provider config file: a list of exec
+// plugins and the image globs each one is responsible for.
+type Config struct {
+	Providers []ProviderConfig `json:"providers"`
+}
+
+// ProviderConfig describes a single exec credential provider plugin.
+type ProviderConfig struct {
+	// Name is the plugin binary's filename. It must not contain a path
+	// separator: the binary is resolved by joining it to the operator's
+	// configured --image-credential-provider-bin-dir, never via $PATH, so a
+	// credential provider config file cannot be used to exec an arbitrary
+	// binary on the node.
+	Name string `json:"name"`
+	// MatchImages is a list of globs (e.g. "*.my-registry.io/*") the plugin
+	// is consulted for. The first provider in Providers whose MatchImages
+	// matches an image wins.
+	MatchImages []string `json:"matchImages"`
+	// DefaultCacheDuration is used when the plugin response omits
+	// cacheDuration, expressed as a Go duration string (e.g. "1h").
+	DefaultCacheDuration string `json:"defaultCacheDuration"`
+	// APIVersion is sent to the plugin in CredentialProviderRequest so it
+	// can validate compatibility.
+	APIVersion string `json:"apiVersion"`
+	// Args are passed to the plugin binary.
+	Args []string `json:"args,omitempty"`
+	// Env is appended to the plugin's environment.
+	Env []EnvVar `json:"env,omitempty"`
+}
+
+// EnvVar is a name/value pair added to a plugin's environment.
+type EnvVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// LoadConfig reads and parses a credential provider config file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credential provider config %q: %w", path, err)
+	}
+
+	config := &Config{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse credential provider config %q: %w", path, err)
+	}
+
+	for _, p := range config.Providers {
+		if p.Name == "" {
+			return nil, fmt.Errorf("invalid credential provider config %q: provider name must not be empty", path)
+		}
+		if len(p.MatchImages) == 0 {
+			return nil, fmt.Errorf("invalid credential provider config %q: provider %q must set matchImages", path, p.Name)
+		}
+	}
+
+	return config, nil
+}
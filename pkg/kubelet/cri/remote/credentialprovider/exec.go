@@ -0,0 +1,134 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package credentialprovider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// execTimeout bounds how long a credential provider plugin may run.
+const execTimeout = 30 * time.Second
+
+// execProvider resolves credentials by running an exec plugin binary and
+// exchanging a CredentialProviderRequest/Response pair over stdin/stdout.
+// binaryPath is always rooted under the operator's configured
+// --image-credential-provider-bin-dir; it is never resolved via $PATH.
+type execProvider struct {
+	name       string
+	binaryPath string
+	args       []string
+	env        []EnvVar
+	apiVersion string
+}
+
+func (e *execProvider) Provide(ctx context.Context, image string) (*runtimeapi.AuthConfig, error) {
+	auth, _, _, err := e.provide(ctx, image)
+	return auth, err
+}
+
+// provide is Provide plus the cache metadata the plugin response carried, so
+// Registry.Resolve can honor the response's own CacheKeyType and
+// CacheDuration instead of always keying by registry host.
+func (e *execProvider) provide(ctx context.Context, image string) (*runtimeapi.AuthConfig, CacheKeyType, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, execTimeout)
+	defer cancel()
+
+	reqBody, err := json.Marshal(&CredentialProviderRequest{APIVersion: e.apiVersion, Image: image})
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("failed to marshal credential provider request: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, e.binaryPath, e.args...)
+	cmd.Stdin = bytes.NewReader(reqBody)
+	cmd.Env = os.Environ()
+	for _, env := range e.env {
+		cmd.Env = append(cmd.Env, env.Name+"="+env.Value)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	klog.V(4).InfoS("Invoking credential provider plugin", "plugin", e.name, "image", image)
+
+	if err := cmd.Run(); err != nil {
+		return nil, "", 0, fmt.Errorf("credential provider plugin %q failed: %w: %s", e.name, err, stderr.String())
+	}
+
+	resp := &CredentialProviderResponse{}
+	if err := json.Unmarshal(stdout.Bytes(), resp); err != nil {
+		return nil, "", 0, fmt.Errorf("failed to parse response from credential provider plugin %q: %w", e.name, err)
+	}
+
+	var cacheDuration time.Duration
+	if resp.CacheDuration != "" {
+		cacheDuration, err = time.ParseDuration(resp.CacheDuration)
+		if err != nil {
+			return nil, "", 0, fmt.Errorf("credential provider plugin %q returned invalid cacheDuration %q: %w", e.name, resp.CacheDuration, err)
+		}
+	}
+
+	return authConfigForImage(image, resp.Auth), resp.CacheKeyType, cacheDuration, nil
+}
+
+// authConfigForImage picks the auth entry whose registry pattern matches
+// image out of a plugin response, preferring an exact registry match over a
+// wildcard one.
+func authConfigForImage(image string, auth map[string]AuthEntry) *runtimeapi.AuthConfig {
+	registry := registryHost(image)
+
+	if entry, ok := auth[registry]; ok {
+		return toAuthConfig(entry)
+	}
+
+	var best string
+	var bestEntry AuthEntry
+	for pattern, entry := range auth {
+		if !matchHost(pattern, registry) {
+			continue
+		}
+		if len(pattern) > len(best) {
+			best = pattern
+			bestEntry = entry
+		}
+	}
+
+	if best == "" {
+		return nil
+	}
+
+	return toAuthConfig(bestEntry)
+}
+
+func toAuthConfig(entry AuthEntry) *runtimeapi.AuthConfig {
+	return &runtimeapi.AuthConfig{
+		Username:      entry.Username,
+		Password:      entry.Password,
+		Auth:          entry.Auth,
+		IdentityToken: entry.IdentityToken,
+	}
+}
@@ -0,0 +1,42 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package credentialprovider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthConfigForImage(t *testing.T) {
+	auth := map[string]AuthEntry{
+		"*.my-registry.io": {Username: "wildcard-user"},
+		"my-registry.io":   {Username: "exact-user"},
+	}
+
+	got := authConfigForImage("my-registry.io/team/app:v1", auth)
+	if assert.NotNil(t, got) {
+		assert.Equal(t, "exact-user", got.Username)
+	}
+
+	got = authConfigForImage("sub.my-registry.io/team/app:v1", auth)
+	if assert.NotNil(t, got) {
+		assert.Equal(t, "wildcard-user", got.Username)
+	}
+
+	assert.Nil(t, authConfigForImage("other.io/team/app:v1", auth))
+}
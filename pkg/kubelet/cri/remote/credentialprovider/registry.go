@@ -0,0 +1,275 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package credentialprovider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+const defaultCacheDuration = time.Minute
+
+// cacheAwareProvider is implemented by CredentialProvider implementations
+// that can report the CacheKeyType/CacheDuration their last response
+// actually carried, rather than forcing every caller onto a static default.
+// execProvider implements this; registeredProvider.resolve falls back to
+// RegistryPluginCacheKeyType and the provider's defaultCacheDuration for
+// providers that don't.
+type cacheAwareProvider interface {
+	provide(ctx context.Context, image string) (*runtimeapi.AuthConfig, CacheKeyType, time.Duration, error)
+}
+
+// registeredProvider pairs an exec plugin with the image globs it applies
+// to and the cache its responses are stored in.
+type registeredProvider struct {
+	name                 string
+	matchImages          []string
+	provider             CredentialProvider
+	cache                *responseCache
+	defaultCacheDuration time.Duration
+}
+
+// Registry resolves pull credentials for an image by trying each configured
+// provider's matchImages glob in order and returning the first match.
+type Registry struct {
+	providers []*registeredProvider
+}
+
+// NewRegistry loads a credential provider config file and builds a Registry
+// of exec-backed providers from it. Every provider's binary is resolved
+// under binDir rather than $PATH, mirroring the --image-credential-provider-bin-dir
+// restriction pkg/credentialprovider/plugin enforces: a config file alone
+// must not be able to exec an arbitrary binary on the node.
+func NewRegistry(configPath, binDir string) (*Registry, error) {
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if binDir == "" {
+		return nil, fmt.Errorf("credential provider bin dir must not be empty")
+	}
+
+	registry := &Registry{}
+	for _, p := range config.Providers {
+		cacheDuration := defaultCacheDuration
+		if p.DefaultCacheDuration != "" {
+			d, err := time.ParseDuration(p.DefaultCacheDuration)
+			if err != nil {
+				return nil, fmt.Errorf("invalid defaultCacheDuration for credential provider %q: %w", p.Name, err)
+			}
+			cacheDuration = d
+		}
+
+		binaryPath, err := resolvePluginBinary(binDir, p.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		registry.providers = append(registry.providers, &registeredProvider{
+			name:        p.Name,
+			matchImages: p.MatchImages,
+			provider: &execProvider{
+				name:       p.Name,
+				binaryPath: binaryPath,
+				args:       p.Args,
+				env:        p.Env,
+				apiVersion: p.APIVersion,
+			},
+			cache:                newResponseCache(),
+			defaultCacheDuration: cacheDuration,
+		})
+	}
+
+	return registry, nil
+}
+
+// resolvePluginBinary joins name to binDir and verifies the result is both
+// still inside binDir and an executable regular file. name must not contain
+// a path separator: allowing one would let a config file escape binDir via
+// "../" and exec an arbitrary binary on the node.
+func resolvePluginBinary(binDir, name string) (string, error) {
+	if name != filepath.Base(name) {
+		return "", fmt.Errorf("invalid credential provider name %q: must not contain a path separator", name)
+	}
+
+	path := filepath.Join(binDir, name)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("credential provider binary %q not found in %q: %w", name, binDir, err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("credential provider binary %q in %q is not a regular file", name, binDir)
+	}
+	if info.Mode()&0o111 == 0 {
+		return "", fmt.Errorf("credential provider binary %q in %q is not executable", name, binDir)
+	}
+
+	return path, nil
+}
+
+// Resolve returns the AuthConfig the first matching provider supplies for
+// image, or nil if no configured provider matches.
+func (r *Registry) Resolve(ctx context.Context, image string) (*runtimeapi.AuthConfig, error) {
+	for _, p := range r.providers {
+		if !matchesAnyImagePattern(p.matchImages, image) {
+			continue
+		}
+		return p.resolve(ctx, image)
+	}
+
+	return nil, nil
+}
+
+// resolve checks the cache for image under every key type a prior response
+// from this provider might have used, then falls back to invoking the
+// plugin and caching its response under the key type and duration it
+// actually returned.
+func (p *registeredProvider) resolve(ctx context.Context, image string) (*runtimeapi.AuthConfig, error) {
+	for _, keyType := range []CacheKeyType{ImagePluginCacheKeyType, RegistryPluginCacheKeyType, GlobalPluginCacheKeyType} {
+		if auth, ok := p.cache.get(cacheKeyFor(keyType, image)); ok {
+			klog.V(4).InfoS("Resolved image pull credentials from cache", "provider", p.name, "image", image)
+			return auth, nil
+		}
+	}
+
+	var auth *runtimeapi.AuthConfig
+	var cacheKeyType CacheKeyType
+	var cacheDuration time.Duration
+	var err error
+	if aware, ok := p.provider.(cacheAwareProvider); ok {
+		auth, cacheKeyType, cacheDuration, err = aware.provide(ctx, image)
+	} else {
+		auth, err = p.provider.Provide(ctx, image)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("credential provider %q failed for image %q: %w", p.name, image, err)
+	}
+	if cacheKeyType == "" {
+		cacheKeyType = RegistryPluginCacheKeyType
+	}
+	if cacheDuration == 0 {
+		cacheDuration = p.defaultCacheDuration
+	}
+
+	p.cache.set(cacheKeyFor(cacheKeyType, image), auth, cacheDuration)
+	klog.V(4).InfoS("Resolved image pull credentials from provider", "provider", p.name, "image", image, "cacheKeyType", cacheKeyType)
+	return auth, nil
+}
+
+// cacheKeyFor builds the cache key for a response cached under keyType.
+func cacheKeyFor(keyType CacheKeyType, image string) string {
+	switch keyType {
+	case ImagePluginCacheKeyType:
+		return "image:" + image
+	case GlobalPluginCacheKeyType:
+		return "global"
+	default: // RegistryPluginCacheKeyType
+		return "registry:" + registryHost(image)
+	}
+}
+
+func matchesAnyImagePattern(patterns []string, image string) bool {
+	for _, pattern := range patterns {
+		if matchImagePattern(pattern, image) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchImagePattern matches a glob like "*.my-registry.io/*" or
+// "registry.example.com/team/*" against an image reference. Matching is
+// done by host and path separately, with a leading "*." in the host segment
+// matching any subdomain and a "*" anywhere in the path matching any
+// sequence of characters, including further "/".
+func matchImagePattern(pattern, image string) bool {
+	patternHost, patternPath, patternHasPath := strings.Cut(pattern, "/")
+	imageHost, imagePath, imageHasPath := strings.Cut(image, "/")
+
+	if !matchHost(patternHost, imageHost) {
+		return false
+	}
+	if !patternHasPath {
+		return true
+	}
+	if !imageHasPath {
+		return false
+	}
+
+	return globMatch(patternPath, imagePath)
+}
+
+func matchHost(pattern, host string) bool {
+	if rest, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+rest) || host == rest
+	}
+	return globMatch(pattern, host)
+}
+
+// globMatch reports whether s matches pattern, where "*" in pattern matches
+// any sequence of characters (including none). Unlike path.Match, "*"
+// matches across "/" so that e.g. "team/*" matches "team/sub/app:v1".
+func globMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+
+	last := parts[len(parts)-1]
+	if !strings.HasSuffix(s, last) {
+		return false
+	}
+	s = s[:len(s)-len(last)]
+
+	for _, part := range parts[1 : len(parts)-1] {
+		idx := strings.Index(s, part)
+		if idx == -1 {
+			return false
+		}
+		s = s[idx+len(part):]
+	}
+
+	return true
+}
+
+// registryHost extracts the registry host from an image reference,
+// defaulting to docker.io for references without one (e.g. "busybox:latest"
+// or "library/busybox:latest").
+func registryHost(image string) string {
+	host, _, ok := strings.Cut(image, "/")
+	if !ok {
+		return "docker.io"
+	}
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return "docker.io"
+	}
+	return host
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package credentialprovider
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchImagePattern(t *testing.T) {
+	for _, test := range []struct {
+		pattern string
+		image   string
+		want    bool
+	}{
+		{pattern: "*.my-registry.io/*", image: "sub.my-registry.io/team/app:v1", want: true},
+		{pattern: "*.my-registry.io/*", image: "my-registry.io/team/app:v1", want: true},
+		{pattern: "*.my-registry.io/*", image: "other.io/team/app:v1", want: false},
+		{pattern: "registry.example.com/team/*", image: "registry.example.com/team/app:v1", want: true},
+		{pattern: "registry.example.com/team/*", image: "registry.example.com/other/app:v1", want: false},
+		{pattern: "docker.io/*", image: "busybox:latest", want: false},
+	} {
+		got := matchImagePattern(test.pattern, test.image)
+		assert.Equal(t, test.want, got, "pattern=%q image=%q", test.pattern, test.image)
+	}
+}
+
+func TestResolvePluginBinary(t *testing.T) {
+	binDir := t.TempDir()
+	binPath := filepath.Join(binDir, "my-plugin")
+	require.NoError(t, os.WriteFile(binPath, []byte("#!/bin/sh\n"), 0o755))
+
+	resolved, err := resolvePluginBinary(binDir, "my-plugin")
+	require.NoError(t, err)
+	assert.Equal(t, binPath, resolved)
+
+	_, err = resolvePluginBinary(binDir, "../my-plugin")
+	assert.Error(t, err, "names containing a path separator must be rejected")
+
+	_, err = resolvePluginBinary(binDir, "does-not-exist")
+	assert.Error(t, err, "a binary missing from binDir must be rejected")
+
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "not-executable"), []byte("#!/bin/sh\n"), 0o644))
+	_, err = resolvePluginBinary(binDir, "not-executable")
+	assert.Error(t, err, "a non-executable file must be rejected")
+}
+
+func TestCacheKeyFor(t *testing.T) {
+	for _, test := range []struct {
+		keyType CacheKeyType
+		image   string
+		want    string
+	}{
+		{keyType: ImagePluginCacheKeyType, image: "my-registry.io/team/app:v1", want: "image:my-registry.io/team/app:v1"},
+		{keyType: RegistryPluginCacheKeyType, image: "my-registry.io/team/app:v1", want: "registry:my-registry.io"},
+		{keyType: GlobalPluginCacheKeyType, image: "my-registry.io/team/app:v1", want: "global"},
+	} {
+		assert.Equal(t, test.want, cacheKeyFor(test.keyType, test.image), "keyType=%q image=%q", test.keyType, test.image)
+	}
+}
+
+func TestRegistryHost(t *testing.T) {
+	for _, test := range []struct {
+		image string
+		want  string
+	}{
+		{image: "busybox:latest", want: "docker.io"},
+		{image: "library/busybox:latest", want: "docker.io"},
+		{image: "my-registry.io/team/app:v1", want: "my-registry.io"},
+		{image: "localhost:5000/app:v1", want: "localhost:5000"},
+	} {
+		assert.Equal(t, test.want, registryHost(test.image), "image=%q", test.image)
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package credentialprovider implements exec-based credential plugins for
+// the CRI image client, mirroring k8s.io/kubernetes/pkg/credentialprovider/plugin
+// but wired directly at pkg/kubelet/cri/remote instead of kubelet's image
+// manager.
+package credentialprovider
+
+import (
+	"context"
+
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// CacheKeyType determines how a plugin's response is cached.
+type CacheKeyType string
+
+const (
+	// ImagePluginCacheKeyType caches the response per full image reference.
+	ImagePluginCacheKeyType CacheKeyType = "Image"
+	// RegistryPluginCacheKeyType caches the response per image registry host.
+	RegistryPluginCacheKeyType CacheKeyType = "Registry"
+	// GlobalPluginCacheKeyType caches a single response for every image the
+	// plugin is asked about.
+	GlobalPluginCacheKeyType CacheKeyType = "Global"
+)
+
+// CredentialProviderRequest is sent as JSON on the plugin's stdin.
+type CredentialProviderRequest struct {
+	APIVersion string `json:"apiVersion"`
+	Image      string `json:"image"`
+}
+
+// CredentialProviderResponse is parsed as JSON from the plugin's stdout.
+type CredentialProviderResponse struct {
+	CacheKeyType  CacheKeyType         `json:"cacheKeyType"`
+	CacheDuration string               `json:"cacheDuration,omitempty"`
+	Auth          map[string]AuthEntry `json:"auth"`
+}
+
+// AuthEntry holds the credentials a plugin returned for a single registry
+// host pattern (a host such as "my-registry.io", or "*.my-registry.io" to
+// also match its subdomains). Only the image's registry host is matched
+// against it; the image path is not considered.
+type AuthEntry struct {
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	Auth          string `json:"auth,omitempty"`
+	IdentityToken string `json:"identityToken,omitempty"`
+}
+
+// CredentialProvider resolves pull credentials for an image by invoking an
+// exec plugin, a static source, or any other mechanism. A nil AuthConfig
+// with a nil error means no credentials apply to image.
+type CredentialProvider interface {
+	Provide(ctx context.Context, image string) (*runtimeapi.AuthConfig, error)
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// defaultProgressPollInterval is used when remoteImageService.progressPollInterval is unset.
+const defaultProgressPollInterval = 2 * time.Second
+
+// klogProgressInterval bounds how often PullImageWithProgress logs progress
+// at V(4), independent of progressPollInterval, to avoid flooding logs for
+// runtimes that report progress on every poll.
+const klogProgressInterval = 10 * time.Second
+
+// PullProgress is a single progress update for an in-progress image pull.
+type PullProgress struct {
+	Layer           string
+	BytesDownloaded int64
+	BytesTotal      int64
+	Status          string
+}
+
+// ImagePullProgressReporter is implemented by image services that support
+// streaming pull progress. Callers type-assert for it, since it isn't part
+// of internalapi.ImageManagerService.
+type ImagePullProgressReporter interface {
+	PullImageWithProgress(ctx context.Context, image *runtimeapi.ImageSpec, auth *runtimeapi.AuthConfig, podSandboxConfig *runtimeapi.PodSandboxConfig, progressCh chan<- PullProgress) (string, error)
+}
+
+// PullImageWithProgress pulls image like PullImage, but also polls
+// ImageStatus(verbose=true) at progressPollInterval while the pull is in
+// flight and translates the runtime-specific Info map into PullProgress
+// events on progressCh. progressCh is closed when the pull returns, whether
+// it succeeds or fails. progressCh may be nil, in which case this behaves
+// like an always-pull PullImage call.
+func (r *remoteImageService) PullImageWithProgress(ctx context.Context, image *runtimeapi.ImageSpec, auth *runtimeapi.AuthConfig, podSandboxConfig *runtimeapi.PodSandboxConfig, progressCh chan<- PullProgress) (string, error) {
+	if progressCh != nil {
+		defer close(progressCh)
+	}
+
+	done := make(chan struct{})
+	var bytesCh chan int64
+	if progressCh != nil {
+		bytesCh = make(chan int64, 1)
+		go r.pollPullProgress(image, done, progressCh, bytesCh)
+	}
+
+	start := time.Now()
+	ref, err := r.rawPullImage(ctx, image, auth, podSandboxConfig)
+	close(done)
+
+	if bytesCh != nil {
+		if totalBytes := <-bytesCh; totalBytes > 0 {
+			if elapsed := time.Since(start).Seconds(); elapsed > 0 {
+				imagePullThroughputBytesPerSecond.Observe(float64(totalBytes) / elapsed)
+			}
+		}
+	}
+
+	return ref, err
+}
+
+// pollPullProgress polls ImageStatus until done is closed, forwarding
+// normalized progress events to progressCh, then reports the last known
+// total bytes downloaded across all layers on bytesCh.
+func (r *remoteImageService) pollPullProgress(image *runtimeapi.ImageSpec, done <-chan struct{}, progressCh chan<- PullProgress, bytesCh chan<- int64) {
+	layerBytes := make(map[string]int64)
+	defer func() {
+		var total int64
+		for _, b := range layerBytes {
+			total += b
+		}
+		bytesCh <- total
+	}()
+
+	interval := r.progressPollInterval
+	if interval <= 0 {
+		interval = defaultProgressPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastLog := time.Now()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			status, err := r.ImageStatus(image, true)
+			if err != nil {
+				klog.V(4).InfoS("Failed to poll image pull progress", "image", image.Image, "err", err)
+				continue
+			}
+			if status == nil {
+				continue
+			}
+
+			for _, progress := range parseProgressInfo(status.Info) {
+				layerBytes[progress.Layer] = progress.BytesDownloaded
+
+				select {
+				case progressCh <- progress:
+				case <-done:
+					return
+				}
+			}
+
+			if len(layerBytes) > 0 && time.Since(lastLog) >= klogProgressInterval {
+				klog.V(4).InfoS("Image pull in progress", "image", image.Image, "layers", len(layerBytes))
+				lastLog = time.Now()
+			}
+		}
+	}
+}
+
+// containerdLayerProgress is containerd's per-transfer progress entry, as
+// reported under the "progress" key of ImageStatusResponse.Info.
+type containerdLayerProgress struct {
+	Ref    string `json:"ref"`
+	Status string `json:"status"`
+	Offset int64  `json:"offset"`
+	Total  int64  `json:"total"`
+}
+
+// crioLayerProgress is CRI-O's per-layer progress entry, as reported under
+// the "io.cri-o.image.progress" key of ImageStatusResponse.Info, keyed by
+// layer digest.
+type crioLayerProgress struct {
+	Downloaded int64 `json:"downloaded"`
+	Total      int64 `json:"total"`
+}
+
+// parseProgressInfo normalizes the runtime-specific progress encodings
+// runtimes put in ImageStatusResponse.Info (populated when Verbose is true)
+// into PullProgress events. Unrecognized Info is silently ignored.
+func parseProgressInfo(info map[string]string) []PullProgress {
+	var progress []PullProgress
+
+	if raw, ok := info["progress"]; ok {
+		var entries []containerdLayerProgress
+		if err := json.Unmarshal([]byte(raw), &entries); err == nil {
+			for _, e := range entries {
+				progress = append(progress, PullProgress{
+					Layer:           e.Ref,
+					BytesDownloaded: e.Offset,
+					BytesTotal:      e.Total,
+					Status:          e.Status,
+				})
+			}
+		}
+	}
+
+	if raw, ok := info["io.cri-o.image.progress"]; ok {
+		var layers map[string]crioLayerProgress
+		if err := json.Unmarshal([]byte(raw), &layers); err == nil {
+			for layer, p := range layers {
+				progress = append(progress, PullProgress{
+					Layer:           layer,
+					BytesDownloaded: p.Downloaded,
+					BytesTotal:      p.Total,
+				})
+			}
+		}
+	}
+
+	return progress
+}
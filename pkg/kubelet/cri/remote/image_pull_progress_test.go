@@ -0,0 +1,92 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+func TestParseProgressInfoContainerd(t *testing.T) {
+	info := map[string]string{
+		"progress": `[{"ref":"layer-1","status":"downloading","offset":512,"total":1024}]`,
+	}
+
+	progress := parseProgressInfo(info)
+	if assert.Len(t, progress, 1) {
+		assert.Equal(t, PullProgress{Layer: "layer-1", BytesDownloaded: 512, BytesTotal: 1024, Status: "downloading"}, progress[0])
+	}
+}
+
+func TestParseProgressInfoCRIO(t *testing.T) {
+	info := map[string]string{
+		"io.cri-o.image.progress": `{"sha256:abc":{"downloaded":256,"total":2048}}`,
+	}
+
+	progress := parseProgressInfo(info)
+	if assert.Len(t, progress, 1) {
+		assert.Equal(t, PullProgress{Layer: "sha256:abc", BytesDownloaded: 256, BytesTotal: 2048}, progress[0])
+	}
+}
+
+func TestParseProgressInfoUnrecognized(t *testing.T) {
+	assert.Empty(t, parseProgressInfo(map[string]string{"unrelated": "value"}))
+	assert.Empty(t, parseProgressInfo(nil))
+}
+
+// TestPullImageWithProgress exercises PullImageWithProgress end to end
+// against a fake ImageServiceClient: a short progressPollInterval and a
+// delayed PullImage response give the polling goroutine time to observe and
+// forward at least one progress event before the pull completes, at which
+// point progressCh must be closed.
+func TestPullImageWithProgress(t *testing.T) {
+	fake := &fakeImageServiceClient{
+		statusInfo: map[string]string{
+			"progress": `[{"ref":"layer-1","status":"downloading","offset":512,"total":1024}]`,
+		},
+		pulledImageRef: "sha256:pulled",
+		pullDelay:      20 * time.Millisecond,
+	}
+	svc := newTestRemoteImageService(fake)
+	svc.progressPollInterval = time.Millisecond
+
+	image := &runtimeapi.ImageSpec{Image: "busybox:latest"}
+	progressCh := make(chan PullProgress)
+
+	var received []PullProgress
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for p := range progressCh {
+			received = append(received, p)
+		}
+	}()
+
+	ref, err := svc.PullImageWithProgress(context.Background(), image, nil, nil, progressCh)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:pulled", ref)
+
+	<-done // progressCh is only drained to completion once it has been closed.
+	require.NotEmpty(t, received, "expected at least one progress event before PullImageWithProgress returned")
+	assert.Equal(t, PullProgress{Layer: "layer-1", BytesDownloaded: 512, BytesTotal: 1024, Status: "downloading"}, received[0])
+}
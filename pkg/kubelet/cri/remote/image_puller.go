@@ -0,0 +1,212 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package remote
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog/v2"
+
+	internalapi "k8s.io/cri-api/pkg/apis"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// imagePullerQueueSize bounds how many queued pulls a parallelImagePuller
+// will buffer before PullImage callers block submitting new work.
+const imagePullerQueueSize = 100
+
+// pullCall tracks a single in-flight underlying pull. Concurrent PullImage
+// (or PullImageWithPolicy) requests that key to the same pullCall share it:
+// the first caller triggers the gRPC call, and every other caller just
+// waits on done.
+type pullCall struct {
+	done chan struct{}
+	ref  string
+	err  error
+}
+
+// pullJob is one queued unit of work. execute is a closure over whichever
+// underlying call (PullImage or PullImageWithPolicy) the caller made, so the
+// coordinator's queueing, coalescing, rate limiting and metrics are shared
+// across both entry points.
+type pullJob struct {
+	key     string
+	call    *pullCall
+	execute func() (string, error)
+}
+
+// imagePuller wraps an internalapi.ImageManagerService with an in-flight
+// pull coalescer, and optionally a bounded worker pool with rate limiting.
+// It mirrors the design of pkg/kubelet/images/puller.go, but sits at the
+// CRI client so any consumer of internalapi.ImageManagerService benefits,
+// not just kubelet's image manager.
+//
+// imagePuller always implements ImagePullPolicyEnforcer. When the wrapped
+// service implements it too, policy-gated pulls get the same coalescing and
+// rate limiting as plain PullImage calls; otherwise PullImageWithPolicy
+// returns an error.
+type imagePuller struct {
+	service internalapi.ImageManagerService
+
+	mu       sync.Mutex
+	inflight map[string]*pullCall
+
+	workCh chan *pullJob
+
+	rateLimiter flowcontrol.RateLimiter
+}
+
+// NewSerialImagePuller wraps service so that only one PullImage gRPC call is
+// ever in flight at a time; additional calls queue up FIFO.
+func NewSerialImagePuller(service internalapi.ImageManagerService) internalapi.ImageManagerService {
+	return newImagePuller(service, 1, nil)
+}
+
+// NewParallelImagePuller wraps service with a worker pool of up to
+// maxParallelImagePulls concurrent PullImage gRPC calls, optionally rate
+// limited to qps with the given burst. A qps of zero disables rate
+// limiting.
+func NewParallelImagePuller(service internalapi.ImageManagerService, maxParallelImagePulls int, qps float32, burst int) internalapi.ImageManagerService {
+	var limiter flowcontrol.RateLimiter
+	if qps > 0 {
+		limiter = flowcontrol.NewTokenBucketRateLimiter(qps, burst)
+	}
+	if maxParallelImagePulls <= 0 {
+		maxParallelImagePulls = 1
+	}
+	return newImagePuller(service, maxParallelImagePulls, limiter)
+}
+
+func newImagePuller(service internalapi.ImageManagerService, workers int, rateLimiter flowcontrol.RateLimiter) *imagePuller {
+	p := &imagePuller{
+		service:     service,
+		inflight:    make(map[string]*pullCall),
+		workCh:      make(chan *pullJob, imagePullerQueueSize),
+		rateLimiter: rateLimiter,
+	}
+
+	for i := 0; i < workers; i++ {
+		go p.runWorker()
+	}
+
+	return p
+}
+
+func (p *imagePuller) runWorker() {
+	for job := range p.workCh {
+		imagePullerQueueDepth.Dec()
+		p.executeJob(job)
+	}
+}
+
+func (p *imagePuller) executeJob(job *pullJob) {
+	if p.rateLimiter != nil {
+		p.rateLimiter.Accept()
+	}
+
+	imagePullerInFlight.Inc()
+	start := time.Now()
+	job.call.ref, job.call.err = job.execute()
+	imagePullerPullDuration.Observe(time.Since(start).Seconds())
+	imagePullerInFlight.Dec()
+
+	close(job.call.done)
+
+	p.mu.Lock()
+	delete(p.inflight, job.key)
+	p.mu.Unlock()
+}
+
+// submit coalesces concurrent calls that share key into a single execute
+// call, fanning its result out to every waiter.
+func (p *imagePuller) submit(key string, execute func() (string, error)) (string, error) {
+	p.mu.Lock()
+	if call, ok := p.inflight[key]; ok {
+		p.mu.Unlock()
+		imagePullerCoalescedWaiters.Inc()
+		klog.V(4).InfoS("Coalescing pull call with an already in-flight pull", "key", key)
+		<-call.done
+		return call.ref, call.err
+	}
+
+	call := &pullCall{done: make(chan struct{})}
+	p.inflight[key] = call
+	p.mu.Unlock()
+
+	imagePullerQueueDepth.Inc()
+	p.workCh <- &pullJob{key: key, call: call, execute: execute}
+
+	<-call.done
+	return call.ref, call.err
+}
+
+// PullImage implements internalapi.ImageManagerService.
+func (p *imagePuller) PullImage(image *runtimeapi.ImageSpec, auth *runtimeapi.AuthConfig, sandboxConfig *runtimeapi.PodSandboxConfig) (string, error) {
+	return p.submit(pullCallKey(image, ""), func() (string, error) {
+		return p.service.PullImage(image, auth, sandboxConfig)
+	})
+}
+
+// PullImageWithPolicy implements ImagePullPolicyEnforcer by forwarding to
+// the wrapped service. If the wrapped service does not implement
+// ImagePullPolicyEnforcer it returns an error, since there is no policy
+// semantics to fall back to without silently ignoring the caller's policy.
+// An empty policy is treated as PullPolicyMissing.
+func (p *imagePuller) PullImageWithPolicy(image *runtimeapi.ImageSpec, auth *runtimeapi.AuthConfig, sandboxConfig *runtimeapi.PodSandboxConfig, policy PullPolicy) (string, error) {
+	enforcer, ok := p.service.(ImagePullPolicyEnforcer)
+	if !ok {
+		return "", fmt.Errorf("image service %T does not implement ImagePullPolicyEnforcer", p.service)
+	}
+	if policy == "" {
+		policy = PullPolicyMissing
+	}
+
+	return p.submit(pullCallKey(image, policy), func() (string, error) {
+		return enforcer.PullImageWithPolicy(image, auth, sandboxConfig, policy)
+	})
+}
+
+// ListImages delegates to the wrapped service.
+func (p *imagePuller) ListImages(filter *runtimeapi.ImageFilter) ([]*runtimeapi.Image, error) {
+	return p.service.ListImages(filter)
+}
+
+// ImageStatus delegates to the wrapped service.
+func (p *imagePuller) ImageStatus(image *runtimeapi.ImageSpec, verbose bool) (*runtimeapi.ImageStatusResponse, error) {
+	return p.service.ImageStatus(image, verbose)
+}
+
+// RemoveImage delegates to the wrapped service.
+func (p *imagePuller) RemoveImage(image *runtimeapi.ImageSpec) error {
+	return p.service.RemoveImage(image)
+}
+
+// ImageFsInfo delegates to the wrapped service.
+func (p *imagePuller) ImageFsInfo() ([]*runtimeapi.FilesystemUsage, error) {
+	return p.service.ImageFsInfo()
+}
+
+// pullCallKey identifies pull calls that are safe to coalesce: same image
+// spec and same pull policy (a Never caller and an Always caller for the
+// same image must not share a result). policy is empty for plain PullImage
+// calls, which always behave like an unconditional pull.
+func pullCallKey(image *runtimeapi.ImageSpec, policy PullPolicy) string {
+	return fmt.Sprintf("%s|%v|%s", image.Image, image.Annotations, policy)
+}
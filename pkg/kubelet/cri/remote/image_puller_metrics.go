@@ -0,0 +1,73 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package remote
+
+import (
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const imagePullerSubsystem = "image_puller"
+
+var (
+	imagePullerQueueDepth = metrics.NewGauge(&metrics.GaugeOpts{
+		Subsystem:      imagePullerSubsystem,
+		Name:           "queue_depth",
+		Help:           "Number of PullImage calls queued in the CRI image puller coordinator waiting for a worker.",
+		StabilityLevel: metrics.ALPHA,
+	})
+
+	imagePullerInFlight = metrics.NewGauge(&metrics.GaugeOpts{
+		Subsystem:      imagePullerSubsystem,
+		Name:           "in_flight_pulls",
+		Help:           "Number of PullImage calls currently executing against the container runtime.",
+		StabilityLevel: metrics.ALPHA,
+	})
+
+	imagePullerCoalescedWaiters = metrics.NewCounter(&metrics.CounterOpts{
+		Subsystem:      imagePullerSubsystem,
+		Name:           "coalesced_waiters_total",
+		Help:           "Number of PullImage calls that were coalesced into an already in-flight pull for the same image.",
+		StabilityLevel: metrics.ALPHA,
+	})
+
+	imagePullerPullDuration = metrics.NewHistogram(&metrics.HistogramOpts{
+		Subsystem:      imagePullerSubsystem,
+		Name:           "pull_duration_seconds",
+		Help:           "Duration in seconds of a single underlying PullImage call.",
+		Buckets:        metrics.ExponentialBuckets(0.5, 2, 10),
+		StabilityLevel: metrics.ALPHA,
+	})
+
+	imagePullThroughputBytesPerSecond = metrics.NewHistogram(&metrics.HistogramOpts{
+		Subsystem:      imagePullerSubsystem,
+		Name:           "pull_throughput_bytes_per_second",
+		Help:           "Observed bytes-per-second throughput of PullImageWithProgress calls.",
+		Buckets:        metrics.ExponentialBuckets(1024, 4, 10),
+		StabilityLevel: metrics.ALPHA,
+	})
+)
+
+func init() {
+	legacyregistry.MustRegister(
+		imagePullerQueueDepth,
+		imagePullerInFlight,
+		imagePullerCoalescedWaiters,
+		imagePullerPullDuration,
+		imagePullThroughputBytesPerSecond,
+	)
+}
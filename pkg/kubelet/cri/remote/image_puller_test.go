@@ -0,0 +1,104 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package remote
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// fakeImageManagerService counts PullImage calls and blocks until release
+// is closed, so tests can assert that concurrent callers were coalesced
+// into a single underlying call. It implements both
+// internalapi.ImageManagerService and ImagePullPolicyEnforcer.
+type fakeImageManagerService struct {
+	pullCount int32
+	release   chan struct{}
+}
+
+func (f *fakeImageManagerService) ListImages(filter *runtimeapi.ImageFilter) ([]*runtimeapi.Image, error) {
+	return nil, nil
+}
+
+func (f *fakeImageManagerService) ImageStatus(image *runtimeapi.ImageSpec, verbose bool) (*runtimeapi.ImageStatusResponse, error) {
+	return nil, nil
+}
+
+func (f *fakeImageManagerService) PullImage(image *runtimeapi.ImageSpec, auth *runtimeapi.AuthConfig, sandboxConfig *runtimeapi.PodSandboxConfig) (string, error) {
+	atomic.AddInt32(&f.pullCount, 1)
+	<-f.release
+	return "sha256:pulled", nil
+}
+
+func (f *fakeImageManagerService) PullImageWithPolicy(image *runtimeapi.ImageSpec, auth *runtimeapi.AuthConfig, sandboxConfig *runtimeapi.PodSandboxConfig, policy PullPolicy) (string, error) {
+	return f.PullImage(image, auth, sandboxConfig)
+}
+
+func (f *fakeImageManagerService) RemoveImage(image *runtimeapi.ImageSpec) error { return nil }
+
+func (f *fakeImageManagerService) ImageFsInfo() ([]*runtimeapi.FilesystemUsage, error) {
+	return nil, nil
+}
+
+func TestParallelImagePullerCoalescesConcurrentPulls(t *testing.T) {
+	fake := &fakeImageManagerService{release: make(chan struct{})}
+	puller := NewParallelImagePuller(fake, 4, 0, 0).(ImagePullPolicyEnforcer)
+
+	const callers = 10
+	var wg sync.WaitGroup
+	results := make([]string, callers)
+	errs := make([]error, callers)
+
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ref, err := puller.PullImageWithPolicy(&runtimeapi.ImageSpec{Image: "busybox:latest"}, nil, nil, PullPolicyAlways)
+			results[i] = ref
+			errs[i] = err
+		}(i)
+	}
+
+	// Give every goroutine a chance to enqueue before releasing the pull,
+	// so they land on the same in-flight call instead of racing ahead.
+	time.Sleep(50 * time.Millisecond)
+	close(fake.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fake.pullCount), "expected concurrent pulls for the same image to be coalesced into one call")
+	for i := 0; i < callers; i++ {
+		require.NoError(t, errs[i])
+		assert.Equal(t, "sha256:pulled", results[i])
+	}
+}
+
+func TestSerialImagePullerPullImage(t *testing.T) {
+	fake := &fakeImageManagerService{release: make(chan struct{})}
+	close(fake.release)
+	puller := NewSerialImagePuller(fake)
+
+	ref, err := puller.PullImage(&runtimeapi.ImageSpec{Image: "busybox:latest"}, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:pulled", ref)
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package remote
+
+import runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+// PullPolicy controls when PullImageWithPolicy issues a PullImage gRPC call
+// versus reusing an image that is already present on the node. The
+// semantics mirror podman's `--pull` flag.
+type PullPolicy string
+
+const (
+	// PullPolicyMissing only pulls the image if no image matching ImageSpec
+	// is present locally. This is the default policy.
+	PullPolicyMissing PullPolicy = "missing"
+	// PullPolicyAlways always issues a PullImage call, even if a matching
+	// image is already present locally.
+	PullPolicyAlways PullPolicy = "always"
+	// PullPolicyNever never dials the runtime to pull; it returns the
+	// locally cached image or an error if none is present.
+	PullPolicyNever PullPolicy = "never"
+)
+
+// ImagePullPolicyEnforcer is implemented by image services that support
+// PullPolicy-gated pulls in addition to the unconditional pull
+// internalapi.ImageManagerService.PullImage performs. It is a separate
+// interface, not a change to PullImage's signature, so implementations
+// still satisfy internalapi.ImageManagerService as declared upstream.
+// Callers type-assert for it.
+type ImagePullPolicyEnforcer interface {
+	PullImageWithPolicy(image *runtimeapi.ImageSpec, auth *runtimeapi.AuthConfig, podSandboxConfig *runtimeapi.PodSandboxConfig, policy PullPolicy) (string, error)
+}
@@ -34,18 +34,41 @@ import (
 
 	internalapi "k8s.io/cri-api/pkg/apis"
 	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+	runtimeapiV1alpha2 "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 	"k8s.io/kubernetes/pkg/features"
+	"k8s.io/kubernetes/pkg/kubelet/cri/remote/credentialprovider"
 	"k8s.io/kubernetes/pkg/kubelet/util"
 )
 
 // remoteImageService is a gRPC implementation of internalapi.ImageManagerService.
 type remoteImageService struct {
-	timeout     time.Duration
+	timeout time.Duration
+
 	imageClient runtimeapi.ImageServiceClient
+
+	// imageClientV1alpha2 and useV1alpha2 support container runtimes that only
+	// implement the older v1alpha2 CRI image API (e.g. containerd 1.4/1.5,
+	// pouch). They can be removed once those runtimes are no longer supported.
+	imageClientV1alpha2 runtimeapiV1alpha2.ImageServiceClient
+	useV1alpha2         bool
+
+	// credentialProviders resolves AuthConfig for PullImage calls that don't
+	// already carry caller-supplied credentials. It is nil when no
+	// credential provider config was configured.
+	credentialProviders *credentialprovider.Registry
+
+	// progressPollInterval is how often PullImageWithProgress polls
+	// ImageStatus for progress updates. Zero means defaultProgressPollInterval.
+	progressPollInterval time.Duration
 }
 
 // NewRemoteImageService creates a new internalapi.ImageManagerService.
-func NewRemoteImageService(endpoint string, connectionTimeout time.Duration, tp trace.TracerProvider) (internalapi.ImageManagerService, error) {
+// credentialProviderConfigFile, if non-empty, is loaded as a credential
+// provider config used to resolve PullImage auth when the caller doesn't
+// supply it; credentialProviderBinDir must then be set to the operator's
+// --image-credential-provider-bin-dir, since every plugin named in the
+// config is resolved under that directory, never via $PATH.
+func NewRemoteImageService(endpoint string, connectionTimeout time.Duration, tp trace.TracerProvider, credentialProviderConfigFile, credentialProviderBinDir string) (internalapi.ImageManagerService, error) {
 	klog.V(3).InfoS("Connecting to image service", "endpoint", endpoint)
 	addr, dialer, err := util.GetAddressAndDialer(endpoint)
 	if err != nil {
@@ -80,6 +103,14 @@ func NewRemoteImageService(endpoint string, connectionTimeout time.Duration, tp
 
 	service := &remoteImageService{timeout: connectionTimeout}
 
+	if credentialProviderConfigFile != "" {
+		registry, err := credentialprovider.NewRegistry(credentialProviderConfigFile, credentialProviderBinDir)
+		if err != nil {
+			return nil, fmt.Errorf("load credential provider config: %w", err)
+		}
+		service.credentialProviders = registry
+	}
+
 	if err := service.validateServiceConnection(conn, endpoint); err != nil {
 		return nil, fmt.Errorf("validate service connection: %w", err)
 	}
@@ -89,7 +120,8 @@ func NewRemoteImageService(endpoint string, connectionTimeout time.Duration, tp
 }
 
 // validateServiceConnection tries to connect to the remote image service by
-// using the CRI v1 API version and fails if that's not possible.
+// using the CRI v1 API version and falls back to v1alpha2 if the runtime
+// doesn't implement it.
 func (r *remoteImageService) validateServiceConnection(conn *grpc.ClientConn, endpoint string) error {
 	ctx, cancel := getContextWithTimeout(r.timeout)
 	defer cancel()
@@ -101,7 +133,16 @@ func (r *remoteImageService) validateServiceConnection(conn *grpc.ClientConn, en
 		klog.V(2).InfoS("Validated CRI v1 image API")
 
 	} else if status.Code(err) == codes.Unimplemented {
-		return fmt.Errorf("CRI v1 image API is not implemented for endpoint %q: %w", endpoint, err)
+		klog.V(2).InfoS("Falling back to CRI v1alpha2 image API", "endpoint", endpoint)
+
+		r.imageClientV1alpha2 = runtimeapiV1alpha2.NewImageServiceClient(conn)
+
+		if _, err := r.imageClientV1alpha2.ImageFsInfo(ctx, &runtimeapiV1alpha2.ImageFsInfoRequest{}); err != nil {
+			return fmt.Errorf("neither CRI v1 nor v1alpha2 image API is implemented for endpoint %q: %w", endpoint, err)
+		}
+
+		klog.V(2).InfoS("Validated CRI v1alpha2 image API")
+		r.useV1alpha2 = true
 	}
 
 	return nil
@@ -112,6 +153,9 @@ func (r *remoteImageService) ListImages(filter *runtimeapi.ImageFilter) ([]*runt
 	ctx, cancel := getContextWithTimeout(r.timeout)
 	defer cancel()
 
+	if r.useV1alpha2 {
+		return r.listImagesV1alpha2(ctx, filter)
+	}
 	return r.listImagesV1(ctx, filter)
 }
 
@@ -127,11 +171,31 @@ func (r *remoteImageService) listImagesV1(ctx context.Context, filter *runtimeap
 	return resp.Images, nil
 }
 
+func (r *remoteImageService) listImagesV1alpha2(ctx context.Context, filter *runtimeapi.ImageFilter) ([]*runtimeapi.Image, error) {
+	resp, err := r.imageClientV1alpha2.ListImages(ctx, &runtimeapiV1alpha2.ListImagesRequest{
+		Filter: v1ImageFilterToV1alpha2(filter),
+	})
+	if err != nil {
+		klog.ErrorS(err, "ListImages with filter from image service failed", "filter", filter)
+		return nil, err
+	}
+
+	images := make([]*runtimeapi.Image, 0, len(resp.Images))
+	for _, img := range resp.Images {
+		images = append(images, fromV1alpha2Image(img))
+	}
+
+	return images, nil
+}
+
 // ImageStatus returns the status of the image.
 func (r *remoteImageService) ImageStatus(image *runtimeapi.ImageSpec, verbose bool) (*runtimeapi.ImageStatusResponse, error) {
 	ctx, cancel := getContextWithTimeout(r.timeout)
 	defer cancel()
 
+	if r.useV1alpha2 {
+		return r.imageStatusV1alpha2(ctx, image, verbose)
+	}
 	return r.imageStatusV1(ctx, image, verbose)
 }
 
@@ -157,12 +221,104 @@ func (r *remoteImageService) imageStatusV1(ctx context.Context, image *runtimeap
 	return resp, nil
 }
 
+func (r *remoteImageService) imageStatusV1alpha2(ctx context.Context, image *runtimeapi.ImageSpec, verbose bool) (*runtimeapi.ImageStatusResponse, error) {
+	resp, err := r.imageClientV1alpha2.ImageStatus(ctx, &runtimeapiV1alpha2.ImageStatusRequest{
+		Image:   v1ImageSpecToV1alpha2(image),
+		Verbose: verbose,
+	})
+	if err != nil {
+		klog.ErrorS(err, "Get ImageStatus from image service failed", "image", image.Image)
+		return nil, err
+	}
+
+	if resp.Image != nil {
+		if resp.Image.Id == "" || resp.Image.Size_ == 0 {
+			errorMessage := fmt.Sprintf("Id or size of image %q is not set", image.Image)
+			err := errors.New(errorMessage)
+			klog.ErrorS(err, "ImageStatus failed", "image", image.Image)
+			return nil, err
+		}
+	}
+
+	return &runtimeapi.ImageStatusResponse{
+		Image: fromV1alpha2Image(resp.Image),
+		Info:  resp.Info,
+	}, nil
+}
+
 // PullImage pulls an image with authentication config.
 func (r *remoteImageService) PullImage(image *runtimeapi.ImageSpec, auth *runtimeapi.AuthConfig, podSandboxConfig *runtimeapi.PodSandboxConfig) (string, error) {
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
-	return r.pullImageV1(ctx, image, auth, podSandboxConfig)
+	return r.rawPullImage(ctx, image, auth, podSandboxConfig)
+}
+
+// PullImageWithPolicy pulls an image with authentication config according to
+// policy. An empty policy defaults to PullPolicyMissing. This implements
+// ImagePullPolicyEnforcer.
+func (r *remoteImageService) PullImageWithPolicy(image *runtimeapi.ImageSpec, auth *runtimeapi.AuthConfig, podSandboxConfig *runtimeapi.PodSandboxConfig, policy PullPolicy) (string, error) {
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	pull := func() (string, error) {
+		return r.rawPullImage(ctx, image, auth, podSandboxConfig)
+	}
+
+	switch policy {
+	case PullPolicyNever:
+		cached, ok := r.cachedImageRef(image)
+		if !ok {
+			return "", fmt.Errorf("image %q is not present locally and pull policy is %q", image.Image, PullPolicyNever)
+		}
+		return cached, nil
+
+	case PullPolicyAlways:
+		cached, _ := r.cachedImageRef(image)
+		ref, err := pull()
+		if err != nil {
+			return "", err
+		}
+		if cached != "" && cached != ref {
+			klog.V(2).InfoS("Image changed after pull", "image", image.Image, "previousRef", cached, "newRef", ref)
+		}
+		return ref, nil
+
+	default: // PullPolicyMissing, or unset.
+		if cached, ok := r.cachedImageRef(image); ok {
+			klog.V(4).InfoS("Image already present, skipping pull", "image", image.Image, "imageRef", cached)
+			return cached, nil
+		}
+		return pull()
+	}
+}
+
+// rawPullImage resolves credential provider auth (if the caller didn't
+// supply any) and issues the underlying PullImage gRPC call against
+// whichever CRI API version this connection negotiated.
+func (r *remoteImageService) rawPullImage(ctx context.Context, image *runtimeapi.ImageSpec, auth *runtimeapi.AuthConfig, podSandboxConfig *runtimeapi.PodSandboxConfig) (string, error) {
+	resolvedAuth := auth
+	if resolvedAuth == nil && r.credentialProviders != nil {
+		if providerAuth, err := r.credentialProviders.Resolve(ctx, image.Image); err != nil {
+			klog.ErrorS(err, "Failed to resolve image pull credentials from provider plugins, pulling without auth", "image", image.Image)
+		} else {
+			resolvedAuth = providerAuth
+		}
+	}
+
+	if r.useV1alpha2 {
+		return r.pullImageV1alpha2(ctx, image, resolvedAuth, podSandboxConfig)
+	}
+	return r.pullImageV1(ctx, image, resolvedAuth, podSandboxConfig)
+}
+
+// cachedImageRef returns the locally cached image ID for image, if any.
+func (r *remoteImageService) cachedImageRef(image *runtimeapi.ImageSpec) (string, bool) {
+	status, err := r.ImageStatus(image, false)
+	if err != nil || status == nil || status.Image == nil || status.Image.Id == "" {
+		return "", false
+	}
+	return status.Image.Id, true
 }
 
 func (r *remoteImageService) pullImageV1(ctx context.Context, image *runtimeapi.ImageSpec, auth *runtimeapi.AuthConfig, podSandboxConfig *runtimeapi.PodSandboxConfig) (string, error) {
@@ -185,11 +341,35 @@ func (r *remoteImageService) pullImageV1(ctx context.Context, image *runtimeapi.
 	return resp.ImageRef, nil
 }
 
+func (r *remoteImageService) pullImageV1alpha2(ctx context.Context, image *runtimeapi.ImageSpec, auth *runtimeapi.AuthConfig, podSandboxConfig *runtimeapi.PodSandboxConfig) (string, error) {
+	resp, err := r.imageClientV1alpha2.PullImage(ctx, &runtimeapiV1alpha2.PullImageRequest{
+		Image:         v1ImageSpecToV1alpha2(image),
+		Auth:          v1AuthConfigToV1alpha2(auth),
+		SandboxConfig: v1PodSandboxConfigToV1alpha2(podSandboxConfig),
+	})
+	if err != nil {
+		klog.ErrorS(err, "PullImage from image service failed", "image", image.Image)
+		return "", err
+	}
+
+	if resp.ImageRef == "" {
+		klog.ErrorS(errors.New("PullImage failed"), "ImageRef of image is not set", "image", image.Image)
+		errorMessage := fmt.Sprintf("imageRef of image %q is not set", image.Image)
+		return "", errors.New(errorMessage)
+	}
+
+	return resp.ImageRef, nil
+}
+
 // RemoveImage removes the image.
 func (r *remoteImageService) RemoveImage(image *runtimeapi.ImageSpec) (err error) {
 	ctx, cancel := getContextWithTimeout(r.timeout)
 	defer cancel()
 
+	if r.useV1alpha2 {
+		return r.removeImageV1alpha2(ctx, image)
+	}
+
 	if _, err = r.imageClient.RemoveImage(ctx, &runtimeapi.RemoveImageRequest{
 		Image: image,
 	}); err != nil {
@@ -200,6 +380,17 @@ func (r *remoteImageService) RemoveImage(image *runtimeapi.ImageSpec) (err error
 	return nil
 }
 
+func (r *remoteImageService) removeImageV1alpha2(ctx context.Context, image *runtimeapi.ImageSpec) error {
+	if _, err := r.imageClientV1alpha2.RemoveImage(ctx, &runtimeapiV1alpha2.RemoveImageRequest{
+		Image: v1ImageSpecToV1alpha2(image),
+	}); err != nil {
+		klog.ErrorS(err, "RemoveImage from image service failed", "image", image.Image)
+		return err
+	}
+
+	return nil
+}
+
 // ImageFsInfo returns information of the filesystem that is used to store images.
 func (r *remoteImageService) ImageFsInfo() ([]*runtimeapi.FilesystemUsage, error) {
 	// Do not set timeout, because `ImageFsInfo` takes time.
@@ -207,6 +398,9 @@ func (r *remoteImageService) ImageFsInfo() ([]*runtimeapi.FilesystemUsage, error
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
+	if r.useV1alpha2 {
+		return r.imageFsInfoV1alpha2(ctx)
+	}
 	return r.imageFsInfoV1(ctx)
 }
 
@@ -218,3 +412,167 @@ func (r *remoteImageService) imageFsInfoV1(ctx context.Context) ([]*runtimeapi.F
 	}
 	return resp.GetImageFilesystems(), nil
 }
+
+func (r *remoteImageService) imageFsInfoV1alpha2(ctx context.Context) ([]*runtimeapi.FilesystemUsage, error) {
+	resp, err := r.imageClientV1alpha2.ImageFsInfo(ctx, &runtimeapiV1alpha2.ImageFsInfoRequest{})
+	if err != nil {
+		klog.ErrorS(err, "ImageFsInfo from image service failed")
+		return nil, err
+	}
+
+	usages := make([]*runtimeapi.FilesystemUsage, 0, len(resp.GetImageFilesystems()))
+	for _, usage := range resp.GetImageFilesystems() {
+		usages = append(usages, fromV1alpha2FilesystemUsage(usage))
+	}
+	return usages, nil
+}
+
+// The v1 and v1alpha2 CRI image API types are structurally identical but
+// live in different generated packages, so converting between them requires
+// a per-field copy. These helpers are only exercised when the connected
+// runtime doesn't implement the v1 image API (see validateServiceConnection).
+
+func v1ImageSpecToV1alpha2(spec *runtimeapi.ImageSpec) *runtimeapiV1alpha2.ImageSpec {
+	if spec == nil {
+		return nil
+	}
+	return &runtimeapiV1alpha2.ImageSpec{
+		Image:       spec.Image,
+		Annotations: spec.Annotations,
+	}
+}
+
+func v1ImageFilterToV1alpha2(filter *runtimeapi.ImageFilter) *runtimeapiV1alpha2.ImageFilter {
+	if filter == nil {
+		return nil
+	}
+	return &runtimeapiV1alpha2.ImageFilter{
+		Image: v1ImageSpecToV1alpha2(filter.Image),
+	}
+}
+
+func v1AuthConfigToV1alpha2(auth *runtimeapi.AuthConfig) *runtimeapiV1alpha2.AuthConfig {
+	if auth == nil {
+		return nil
+	}
+	return &runtimeapiV1alpha2.AuthConfig{
+		Username:      auth.Username,
+		Password:      auth.Password,
+		Auth:          auth.Auth,
+		ServerAddress: auth.ServerAddress,
+		IdentityToken: auth.IdentityToken,
+		RegistryToken: auth.RegistryToken,
+	}
+}
+
+func v1PodSandboxConfigToV1alpha2(c *runtimeapi.PodSandboxConfig) *runtimeapiV1alpha2.PodSandboxConfig {
+	if c == nil {
+		return nil
+	}
+
+	config := &runtimeapiV1alpha2.PodSandboxConfig{
+		Hostname:     c.Hostname,
+		LogDirectory: c.LogDirectory,
+		Labels:       c.Labels,
+		Annotations:  c.Annotations,
+	}
+
+	if m := c.Metadata; m != nil {
+		config.Metadata = &runtimeapiV1alpha2.PodSandboxMetadata{
+			Name:      m.Name,
+			Uid:       m.Uid,
+			Namespace: m.Namespace,
+			Attempt:   m.Attempt,
+		}
+	}
+
+	if dns := c.DnsConfig; dns != nil {
+		config.DnsConfig = &runtimeapiV1alpha2.DNSConfig{
+			Servers:  dns.Servers,
+			Searches: dns.Searches,
+			Options:  dns.Options,
+		}
+	}
+
+	for _, p := range c.PortMappings {
+		config.PortMappings = append(config.PortMappings, &runtimeapiV1alpha2.PortMapping{
+			Protocol:      runtimeapiV1alpha2.Protocol(p.Protocol),
+			ContainerPort: p.ContainerPort,
+			HostPort:      p.HostPort,
+			HostIp:        p.HostIp,
+		})
+	}
+
+	if linux := c.Linux; linux != nil {
+		config.Linux = &runtimeapiV1alpha2.LinuxPodSandboxConfig{
+			CgroupParent: linux.CgroupParent,
+			Sysctls:      linux.Sysctls,
+		}
+		if sc := linux.SecurityContext; sc != nil {
+			config.Linux.SecurityContext = &runtimeapiV1alpha2.LinuxSandboxSecurityContext{
+				ReadonlyRootfs:     sc.ReadonlyRootfs,
+				SupplementalGroups: sc.SupplementalGroups,
+				Privileged:         sc.Privileged,
+				SeccompProfilePath: sc.SeccompProfilePath,
+			}
+			if sc.RunAsUser != nil {
+				config.Linux.SecurityContext.RunAsUser = &runtimeapiV1alpha2.Int64Value{Value: sc.RunAsUser.Value}
+			}
+			if sc.RunAsGroup != nil {
+				config.Linux.SecurityContext.RunAsGroup = &runtimeapiV1alpha2.Int64Value{Value: sc.RunAsGroup.Value}
+			}
+			if ns := sc.NamespaceOptions; ns != nil {
+				config.Linux.SecurityContext.NamespaceOptions = &runtimeapiV1alpha2.NamespaceOption{
+					Network:  runtimeapiV1alpha2.NamespaceMode(ns.Network),
+					Pid:      runtimeapiV1alpha2.NamespaceMode(ns.Pid),
+					Ipc:      runtimeapiV1alpha2.NamespaceMode(ns.Ipc),
+					TargetId: ns.TargetId,
+				}
+			}
+		}
+	}
+
+	return config
+}
+
+func fromV1alpha2Image(img *runtimeapiV1alpha2.Image) *runtimeapi.Image {
+	if img == nil {
+		return nil
+	}
+
+	image := &runtimeapi.Image{
+		Id:          img.Id,
+		RepoTags:    img.RepoTags,
+		RepoDigests: img.RepoDigests,
+		Size_:       img.Size_,
+		Username:    img.Username,
+	}
+
+	if img.Uid != nil {
+		image.Uid = &runtimeapi.Int64Value{Value: img.Uid.Value}
+	}
+
+	return image
+}
+
+func fromV1alpha2FilesystemUsage(usage *runtimeapiV1alpha2.FilesystemUsage) *runtimeapi.FilesystemUsage {
+	if usage == nil {
+		return nil
+	}
+
+	fsUsage := &runtimeapi.FilesystemUsage{
+		Timestamp: usage.Timestamp,
+	}
+
+	if usage.FsId != nil {
+		fsUsage.FsId = &runtimeapi.FilesystemIdentifier{Mountpoint: usage.FsId.Mountpoint}
+	}
+	if usage.UsedBytes != nil {
+		fsUsage.UsedBytes = &runtimeapi.UInt64Value{Value: usage.UsedBytes.Value}
+	}
+	if usage.InodesUsed != nil {
+		fsUsage.InodesUsed = &runtimeapi.UInt64Value{Value: usage.InodesUsed.Value}
+	}
+
+	return fsUsage
+}
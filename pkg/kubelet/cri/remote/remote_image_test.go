@@ -0,0 +1,356 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+	runtimeapiV1alpha2 "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// fakeImageServiceClient is a minimal, hand-rolled runtimeapi.ImageServiceClient
+// that records the sequence of calls made against it so tests can assert on
+// PullImage's policy-driven call sequence without dialing a real runtime.
+type fakeImageServiceClient struct {
+	calls []string
+
+	// cachedImage is returned by ImageStatus, simulating an image already
+	// present on the node. A nil value simulates a cache miss.
+	cachedImage *runtimeapi.Image
+	// statusInfo is returned as ImageStatusResponse.Info, e.g. to simulate a
+	// runtime reporting pull progress when Verbose is set.
+	statusInfo map[string]string
+	// pulledImageRef is returned by PullImage.
+	pulledImageRef string
+	pullErr        error
+	// pullDelay, if set, is slept in PullImage before returning, so tests
+	// can observe behavior that happens while a pull is still in flight.
+	pullDelay time.Duration
+}
+
+func (f *fakeImageServiceClient) ListImages(ctx context.Context, in *runtimeapi.ListImagesRequest, opts ...grpc.CallOption) (*runtimeapi.ListImagesResponse, error) {
+	f.calls = append(f.calls, "ListImages")
+	return &runtimeapi.ListImagesResponse{}, nil
+}
+
+func (f *fakeImageServiceClient) ImageStatus(ctx context.Context, in *runtimeapi.ImageStatusRequest, opts ...grpc.CallOption) (*runtimeapi.ImageStatusResponse, error) {
+	f.calls = append(f.calls, "ImageStatus")
+	return &runtimeapi.ImageStatusResponse{Image: f.cachedImage, Info: f.statusInfo}, nil
+}
+
+func (f *fakeImageServiceClient) PullImage(ctx context.Context, in *runtimeapi.PullImageRequest, opts ...grpc.CallOption) (*runtimeapi.PullImageResponse, error) {
+	f.calls = append(f.calls, "PullImage")
+	if f.pullDelay > 0 {
+		time.Sleep(f.pullDelay)
+	}
+	if f.pullErr != nil {
+		return nil, f.pullErr
+	}
+	return &runtimeapi.PullImageResponse{ImageRef: f.pulledImageRef}, nil
+}
+
+func (f *fakeImageServiceClient) RemoveImage(ctx context.Context, in *runtimeapi.RemoveImageRequest, opts ...grpc.CallOption) (*runtimeapi.RemoveImageResponse, error) {
+	f.calls = append(f.calls, "RemoveImage")
+	return &runtimeapi.RemoveImageResponse{}, nil
+}
+
+func (f *fakeImageServiceClient) ImageFsInfo(ctx context.Context, in *runtimeapi.ImageFsInfoRequest, opts ...grpc.CallOption) (*runtimeapi.ImageFsInfoResponse, error) {
+	f.calls = append(f.calls, "ImageFsInfo")
+	return &runtimeapi.ImageFsInfoResponse{}, nil
+}
+
+func newTestRemoteImageService(fake *fakeImageServiceClient) *remoteImageService {
+	return &remoteImageService{
+		timeout:     time.Minute,
+		imageClient: fake,
+	}
+}
+
+func TestPullImagePolicies(t *testing.T) {
+	image := &runtimeapi.ImageSpec{Image: "busybox:latest"}
+
+	for _, test := range []struct {
+		name         string
+		policy       PullPolicy
+		cachedImage  *runtimeapi.Image
+		pulledRef    string
+		wantCalls    []string
+		wantImageRef string
+		wantErr      bool
+	}{
+		{
+			name:         "missing policy with cache hit skips pull",
+			policy:       PullPolicyMissing,
+			cachedImage:  &runtimeapi.Image{Id: "sha256:cached", Size_: 42},
+			wantCalls:    []string{"ImageStatus"},
+			wantImageRef: "sha256:cached",
+		},
+		{
+			name:         "missing policy with cache miss pulls",
+			policy:       PullPolicyMissing,
+			cachedImage:  nil,
+			pulledRef:    "sha256:pulled",
+			wantCalls:    []string{"ImageStatus", "PullImage"},
+			wantImageRef: "sha256:pulled",
+		},
+		{
+			name:         "always policy pulls even on cache hit",
+			policy:       PullPolicyAlways,
+			cachedImage:  &runtimeapi.Image{Id: "sha256:cached", Size_: 42},
+			pulledRef:    "sha256:pulled",
+			wantCalls:    []string{"ImageStatus", "PullImage"},
+			wantImageRef: "sha256:pulled",
+		},
+		{
+			name:        "never policy with cache miss errors without pulling",
+			policy:      PullPolicyNever,
+			cachedImage: nil,
+			wantCalls:   []string{"ImageStatus"},
+			wantErr:     true,
+		},
+		{
+			name:         "never policy with cache hit returns cached ref without pulling",
+			policy:       PullPolicyNever,
+			cachedImage:  &runtimeapi.Image{Id: "sha256:cached", Size_: 42},
+			wantCalls:    []string{"ImageStatus"},
+			wantImageRef: "sha256:cached",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fake := &fakeImageServiceClient{cachedImage: test.cachedImage, pulledImageRef: test.pulledRef}
+			svc := newTestRemoteImageService(fake)
+
+			ref, err := svc.PullImageWithPolicy(image, nil, nil, test.policy)
+			if test.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.wantImageRef, ref)
+			assert.Equal(t, test.wantCalls, fake.calls)
+		})
+	}
+}
+
+// fakeImageServiceClientV1alpha2 is the v1alpha2 counterpart of
+// fakeImageServiceClient, used to exercise the CRI v1alpha2 fallback path
+// (see validateServiceConnection) that remoteImageService dispatches to
+// when useV1alpha2 is set.
+type fakeImageServiceClientV1alpha2 struct {
+	calls []string
+
+	images      []*runtimeapiV1alpha2.Image
+	cachedImage *runtimeapiV1alpha2.Image
+
+	pulledImageRef  string
+	pullErr         error
+	lastPullRequest *runtimeapiV1alpha2.PullImageRequest
+
+	fsUsages []*runtimeapiV1alpha2.FilesystemUsage
+}
+
+func (f *fakeImageServiceClientV1alpha2) ListImages(ctx context.Context, in *runtimeapiV1alpha2.ListImagesRequest, opts ...grpc.CallOption) (*runtimeapiV1alpha2.ListImagesResponse, error) {
+	f.calls = append(f.calls, "ListImages")
+	return &runtimeapiV1alpha2.ListImagesResponse{Images: f.images}, nil
+}
+
+func (f *fakeImageServiceClientV1alpha2) ImageStatus(ctx context.Context, in *runtimeapiV1alpha2.ImageStatusRequest, opts ...grpc.CallOption) (*runtimeapiV1alpha2.ImageStatusResponse, error) {
+	f.calls = append(f.calls, "ImageStatus")
+	return &runtimeapiV1alpha2.ImageStatusResponse{Image: f.cachedImage}, nil
+}
+
+func (f *fakeImageServiceClientV1alpha2) PullImage(ctx context.Context, in *runtimeapiV1alpha2.PullImageRequest, opts ...grpc.CallOption) (*runtimeapiV1alpha2.PullImageResponse, error) {
+	f.calls = append(f.calls, "PullImage")
+	f.lastPullRequest = in
+	if f.pullErr != nil {
+		return nil, f.pullErr
+	}
+	return &runtimeapiV1alpha2.PullImageResponse{ImageRef: f.pulledImageRef}, nil
+}
+
+func (f *fakeImageServiceClientV1alpha2) RemoveImage(ctx context.Context, in *runtimeapiV1alpha2.RemoveImageRequest, opts ...grpc.CallOption) (*runtimeapiV1alpha2.RemoveImageResponse, error) {
+	f.calls = append(f.calls, "RemoveImage")
+	return &runtimeapiV1alpha2.RemoveImageResponse{}, nil
+}
+
+func (f *fakeImageServiceClientV1alpha2) ImageFsInfo(ctx context.Context, in *runtimeapiV1alpha2.ImageFsInfoRequest, opts ...grpc.CallOption) (*runtimeapiV1alpha2.ImageFsInfoResponse, error) {
+	f.calls = append(f.calls, "ImageFsInfo")
+	return &runtimeapiV1alpha2.ImageFsInfoResponse{ImageFilesystems: f.fsUsages}, nil
+}
+
+func newTestRemoteImageServiceV1alpha2(fake *fakeImageServiceClientV1alpha2) *remoteImageService {
+	return &remoteImageService{
+		timeout:             time.Minute,
+		imageClientV1alpha2: fake,
+		useV1alpha2:         true,
+	}
+}
+
+// TestRemoteImageServiceV1Alpha2Fallback exercises every remoteImageService
+// method against the CRI v1alpha2 fallback path, asserting both that
+// dispatch reaches imageClientV1alpha2 and that the v1/v1alpha2 conversion
+// helpers round-trip results correctly. This guards against regressions
+// like the one fixed in the NamespaceOptions conversion, which a pointer
+// cast between the structurally-different v1 and v1alpha2 types would have
+// silently corrupted without any test catching it.
+func TestRemoteImageServiceV1Alpha2Fallback(t *testing.T) {
+	image := &runtimeapi.ImageSpec{Image: "busybox:latest"}
+	podSandboxConfig := &runtimeapi.PodSandboxConfig{
+		Linux: &runtimeapi.LinuxPodSandboxConfig{
+			SecurityContext: &runtimeapi.LinuxSandboxSecurityContext{
+				NamespaceOptions: &runtimeapi.NamespaceOption{
+					Network:  runtimeapi.NamespaceMode_POD,
+					Pid:      runtimeapi.NamespaceMode_CONTAINER,
+					Ipc:      runtimeapi.NamespaceMode_NODE,
+					TargetId: "target-container-id",
+				},
+			},
+		},
+	}
+
+	fake := &fakeImageServiceClientV1alpha2{
+		images:         []*runtimeapiV1alpha2.Image{{Id: "sha256:abc", RepoTags: []string{"busybox:latest"}, Size_: 42}},
+		cachedImage:    &runtimeapiV1alpha2.Image{Id: "sha256:abc", Size_: 42},
+		pulledImageRef: "sha256:pulled",
+		fsUsages:       []*runtimeapiV1alpha2.FilesystemUsage{{Timestamp: 1234}},
+	}
+	svc := newTestRemoteImageServiceV1alpha2(fake)
+
+	images, err := svc.ListImages(nil)
+	require.NoError(t, err)
+	require.Len(t, images, 1)
+	assert.Equal(t, "sha256:abc", images[0].Id)
+
+	status, err := svc.ImageStatus(image, false)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:abc", status.Image.Id)
+
+	ref, err := svc.PullImage(image, nil, podSandboxConfig)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:pulled", ref)
+	require.NotNil(t, fake.lastPullRequest)
+	gotNamespaceOptions := fake.lastPullRequest.SandboxConfig.Linux.SecurityContext.NamespaceOptions
+	assert.Equal(t, &runtimeapiV1alpha2.NamespaceOption{
+		Network:  runtimeapiV1alpha2.NamespaceMode_POD,
+		Pid:      runtimeapiV1alpha2.NamespaceMode_CONTAINER,
+		Ipc:      runtimeapiV1alpha2.NamespaceMode_NODE,
+		TargetId: "target-container-id",
+	}, gotNamespaceOptions)
+
+	require.NoError(t, svc.RemoveImage(image))
+
+	usages, err := svc.ImageFsInfo()
+	require.NoError(t, err)
+	require.Len(t, usages, 1)
+	assert.Equal(t, int64(1234), usages[0].Timestamp)
+
+	assert.Equal(t, []string{"ListImages", "ImageStatus", "PullImage", "RemoveImage", "ImageFsInfo"}, fake.calls)
+}
+
+// TestV1PodSandboxConfigToV1alpha2 is a dedicated regression test for the
+// PodSandboxConfig field-copy conversion, covering every nested field
+// including SecurityContext.NamespaceOptions.
+func TestV1PodSandboxConfigToV1alpha2(t *testing.T) {
+	c := &runtimeapi.PodSandboxConfig{
+		Hostname:     "test-host",
+		LogDirectory: "/var/log/pods/test",
+		Labels:       map[string]string{"app": "test"},
+		Annotations:  map[string]string{"owner": "test"},
+		Metadata: &runtimeapi.PodSandboxMetadata{
+			Name:      "test-pod",
+			Uid:       "test-uid",
+			Namespace: "test-ns",
+			Attempt:   1,
+		},
+		DnsConfig: &runtimeapi.DNSConfig{
+			Servers:  []string{"8.8.8.8"},
+			Searches: []string{"svc.cluster.local"},
+			Options:  []string{"ndots:5"},
+		},
+		PortMappings: []*runtimeapi.PortMapping{
+			{Protocol: runtimeapi.Protocol_TCP, ContainerPort: 80, HostPort: 8080, HostIp: "127.0.0.1"},
+		},
+		Linux: &runtimeapi.LinuxPodSandboxConfig{
+			CgroupParent: "/kubepods",
+			Sysctls:      map[string]string{"net.core.somaxconn": "1024"},
+			SecurityContext: &runtimeapi.LinuxSandboxSecurityContext{
+				RunAsUser:          &runtimeapi.Int64Value{Value: 1000},
+				RunAsGroup:         &runtimeapi.Int64Value{Value: 1000},
+				ReadonlyRootfs:     true,
+				SupplementalGroups: []int64{1001, 1002},
+				Privileged:         false,
+				SeccompProfilePath: "runtime/default",
+				NamespaceOptions: &runtimeapi.NamespaceOption{
+					Network:  runtimeapi.NamespaceMode_POD,
+					Pid:      runtimeapi.NamespaceMode_CONTAINER,
+					Ipc:      runtimeapi.NamespaceMode_NODE,
+					TargetId: "target-container-id",
+				},
+			},
+		},
+	}
+
+	got := v1PodSandboxConfigToV1alpha2(c)
+
+	want := &runtimeapiV1alpha2.PodSandboxConfig{
+		Hostname:     "test-host",
+		LogDirectory: "/var/log/pods/test",
+		Labels:       map[string]string{"app": "test"},
+		Annotations:  map[string]string{"owner": "test"},
+		Metadata: &runtimeapiV1alpha2.PodSandboxMetadata{
+			Name:      "test-pod",
+			Uid:       "test-uid",
+			Namespace: "test-ns",
+			Attempt:   1,
+		},
+		DnsConfig: &runtimeapiV1alpha2.DNSConfig{
+			Servers:  []string{"8.8.8.8"},
+			Searches: []string{"svc.cluster.local"},
+			Options:  []string{"ndots:5"},
+		},
+		PortMappings: []*runtimeapiV1alpha2.PortMapping{
+			{Protocol: runtimeapiV1alpha2.Protocol_TCP, ContainerPort: 80, HostPort: 8080, HostIp: "127.0.0.1"},
+		},
+		Linux: &runtimeapiV1alpha2.LinuxPodSandboxConfig{
+			CgroupParent: "/kubepods",
+			Sysctls:      map[string]string{"net.core.somaxconn": "1024"},
+			SecurityContext: &runtimeapiV1alpha2.LinuxSandboxSecurityContext{
+				RunAsUser:          &runtimeapiV1alpha2.Int64Value{Value: 1000},
+				RunAsGroup:         &runtimeapiV1alpha2.Int64Value{Value: 1000},
+				ReadonlyRootfs:     true,
+				SupplementalGroups: []int64{1001, 1002},
+				Privileged:         false,
+				SeccompProfilePath: "runtime/default",
+				NamespaceOptions: &runtimeapiV1alpha2.NamespaceOption{
+					Network:  runtimeapiV1alpha2.NamespaceMode_POD,
+					Pid:      runtimeapiV1alpha2.NamespaceMode_CONTAINER,
+					Ipc:      runtimeapiV1alpha2.NamespaceMode_NODE,
+					TargetId: "target-container-id",
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, want, got)
+}